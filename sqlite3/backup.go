@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// dumpTables lists the tables, in a fixed order, that backupDB dumps and
+// restoreDB recreates. Keeping this list explicit (rather than querying
+// sqlite_master) makes the dump deterministic across schema migrations.
+var dumpTables = []string{"scans", "files"}
+
+// sqliteTimestampLayout matches one of the formats go-sqlite3 itself
+// parses DATETIME columns back into time.Time with (see its
+// SQLiteTimestampFormats). Using anything else - including time.Time's
+// default String() or time.RFC3339Nano - round-trips through a dump and
+// restore as different text, or fails to parse as a DATETIME at all.
+const sqliteTimestampLayout = "2006-01-02T15:04:05.999999999-07:00"
+
+// backupDB writes a deterministic, human-diffable dump of db to w: a
+// CREATE TABLE statement per table followed by one INSERT per row, the
+// whole thing zstd-compressed. Because it's plain SQL text it survives
+// SQLite version and architecture changes, unlike copying the file.
+func backupDB(db *sql.DB, w io.Writer) error {
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return fmt.Errorf("error creating zstd writer: %v", err)
+	}
+	defer zw.Close()
+
+	bw := bufio.NewWriter(zw)
+
+	for _, table := range dumpTables {
+		createSQL, err := tableCreateSQL(db, table)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(bw, "%s;\n", createSQL); err != nil {
+			return fmt.Errorf("error writing dump: %v", err)
+		}
+
+		if err := dumpTableRows(db, table, bw); err != nil {
+			return err
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("error flushing dump: %v", err)
+	}
+	return zw.Close()
+}
+
+// tableCreateSQL fetches the exact CREATE TABLE statement SQLite used for
+// table, so restoreDB recreates the schema byte-for-byte.
+func tableCreateSQL(db *sql.DB, table string) (string, error) {
+	var sqlText string
+	err := db.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&sqlText)
+	if err != nil {
+		return "", fmt.Errorf("error reading schema for %q: %v", table, err)
+	}
+	return sqlText, nil
+}
+
+// dumpTableRows writes one deterministically-ordered INSERT statement per
+// row of table to w.
+func dumpTableRows(db *sql.DB, table string, w io.Writer) error {
+	cols, err := tableColumns(db, table)
+	if err != nil {
+		return err
+	}
+
+	orderBy := cols[0]
+	rows, err := db.Query(fmt.Sprintf("SELECT %s FROM %s ORDER BY %s", strings.Join(cols, ", "), table, orderBy))
+	if err != nil {
+		return fmt.Errorf("error reading rows from %q: %v", table, err)
+	}
+	defer rows.Close()
+
+	values := make([]interface{}, len(cols))
+	scanArgs := make([]interface{}, len(cols))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(scanArgs...); err != nil {
+			return fmt.Errorf("error scanning row from %q: %v", table, err)
+		}
+
+		literals := make([]string, len(values))
+		for i, v := range values {
+			literals[i] = sqlLiteral(v)
+		}
+
+		stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);\n", table, strings.Join(cols, ", "), strings.Join(literals, ", "))
+		if _, err := io.WriteString(w, stmt); err != nil {
+			return fmt.Errorf("error writing dump: %v", err)
+		}
+	}
+
+	return rows.Err()
+}
+
+func tableColumns(db *sql.DB, table string) ([]string, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, fmt.Errorf("error reading columns for %q: %v", table, err)
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var cid int
+		var name, colType string
+		var notNull, pk int
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return nil, fmt.Errorf("error scanning column info for %q: %v", table, err)
+		}
+		cols = append(cols, name)
+	}
+	return cols, rows.Err()
+}
+
+// sqlLiteral renders v as a SQL literal suitable for an INSERT statement.
+func sqlLiteral(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return "'" + strings.ReplaceAll(string(val), "'", "''") + "'"
+	case string:
+		return "'" + strings.ReplaceAll(val, "'", "''") + "'"
+	case int64:
+		return fmt.Sprintf("%d", val)
+	case float64:
+		return fmt.Sprintf("%v", val)
+	case time.Time:
+		return "'" + val.Format(sqliteTimestampLayout) + "'"
+	default:
+		return fmt.Sprintf("'%v'", val)
+	}
+}
+
+// restoreDB reads a dump produced by backupDB from r and replays it into
+// db inside a single transaction.
+func restoreDB(db *sql.DB, r io.Reader) error {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("error creating zstd reader: %v", err)
+	}
+	defer zr.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting restore transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	scanner := bufio.NewScanner(zr)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var stmt strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		stmt.WriteString(line)
+		stmt.WriteByte('\n')
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			if _, err := tx.Exec(stmt.String()); err != nil {
+				return fmt.Errorf("error replaying statement %q: %v", stmt.String(), err)
+			}
+			stmt.Reset()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading dump: %v", err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+var (
+	filesBucket = []byte("files")
+	scansBucket = []byte("scans")
+)
+
+// boltFile is the JSON value stored in filesBucket under fileKey(path, inode).
+type boltFile struct {
+	Size          int64     `json:"size"`
+	ModTime       time.Time `json:"mod_time"`
+	BirthTime     time.Time `json:"birth_time"`
+	Inode         uint64    `json:"inode"`
+	Hash          string    `json:"hash"`
+	Status        string    `json:"status"`
+	FirstSeenScan int64     `json:"first_seen_scan"`
+	LastSeenScan  int64     `json:"last_seen_scan"`
+}
+
+// boltScan is the JSON value stored per scan id in scansBucket.
+type boltScan struct {
+	Root       string    `json:"root"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// boltStore is a bbolt-backed Store. Its mmap'd single-writer B+tree
+// avoids the WAL/journal churn SQLite pays for on SD cards, at the cost
+// of giving up SQL for everything downstream (ad-hoc queries, the SQL
+// backup/restore subcommands).
+type boltStore struct {
+	db *bbolt.DB
+}
+
+func openBoltStore(path string) (Store, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening bbolt database: %v", err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, bucket := range [][]byte{filesBucket, scansBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return fmt.Errorf("error creating bucket %q: %v", bucket, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) StartScan(root string) (int64, error) {
+	var scanID int64
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(scansBucket)
+		id, err := b.NextSequence()
+		if err != nil {
+			return fmt.Errorf("error allocating scan id: %v", err)
+		}
+		scanID = int64(id)
+
+		data, err := json.Marshal(boltScan{Root: root, StartedAt: time.Now()})
+		if err != nil {
+			return fmt.Errorf("error encoding scan: %v", err)
+		}
+		return b.Put(scanKey(scanID), data)
+	})
+	return scanID, err
+}
+
+func (s *boltStore) FinishScan(scanID int64) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		scans := tx.Bucket(scansBucket)
+		data := scans.Get(scanKey(scanID))
+		if data == nil {
+			return fmt.Errorf("unknown scan id %d", scanID)
+		}
+		var sc boltScan
+		if err := json.Unmarshal(data, &sc); err != nil {
+			return fmt.Errorf("error decoding scan: %v", err)
+		}
+		sc.FinishedAt = time.Now()
+		data, err := json.Marshal(sc)
+		if err != nil {
+			return fmt.Errorf("error encoding scan: %v", err)
+		}
+		if err := scans.Put(scanKey(scanID), data); err != nil {
+			return err
+		}
+
+		// bbolt's Bucket.ForEach contract forbids mutating the bucket
+		// from within the callback, so the keys to mark deleted are
+		// collected here and written only after ForEach returns.
+		files := tx.Bucket(filesBucket)
+		toDelete := make(map[string]boltFile)
+		err = files.ForEach(func(k, v []byte) error {
+			var bf boltFile
+			if err := json.Unmarshal(v, &bf); err != nil {
+				return fmt.Errorf("error decoding file %q: %v", k, err)
+			}
+			if bf.LastSeenScan != scanID && bf.Status != "deleted" {
+				bf.Status = "deleted"
+				toDelete[string(k)] = bf
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for k, bf := range toDelete {
+			data, err := json.Marshal(bf)
+			if err != nil {
+				return fmt.Errorf("error encoding file %q: %v", k, err)
+			}
+			if err := files.Put([]byte(k), data); err != nil {
+				return fmt.Errorf("error writing file %q: %v", k, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) FindFile(path string, inode uint64) (existingFile, bool, error) {
+	var ef existingFile
+	var found bool
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(filesBucket).Get(fileKey(path, inode))
+		if v == nil {
+			return nil
+		}
+		var bf boltFile
+		if err := json.Unmarshal(v, &bf); err != nil {
+			return fmt.Errorf("error decoding file %q: %v", path, err)
+		}
+		ef = existingFile{size: bf.Size, modTime: bf.ModTime, hash: bf.Hash}
+		found = true
+		return nil
+	})
+	return ef, found, err
+}
+
+func (s *boltStore) CountByStatus(scanID int64, status string) (int, error) {
+	var count int
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(filesBucket).ForEach(func(k, v []byte) error {
+			var bf boltFile
+			if err := json.Unmarshal(v, &bf); err != nil {
+				return fmt.Errorf("error decoding file %q: %v", k, err)
+			}
+			if bf.Status != status {
+				return nil
+			}
+			if status == "deleted" || bf.LastSeenScan == scanID {
+				count++
+			}
+			return nil
+		})
+	})
+	return count, err
+}
+
+func (s *boltStore) BeginBatch() (Batch, error) {
+	tx, err := s.db.Begin(true)
+	if err != nil {
+		return nil, fmt.Errorf("error starting bbolt transaction: %v", err)
+	}
+	return &boltBatch{tx: tx}, nil
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+// boltBatch is a single read-write bbolt transaction.
+type boltBatch struct {
+	tx *bbolt.Tx
+}
+
+func (b *boltBatch) PutFile(rec fileRecord) error {
+	files := b.tx.Bucket(filesBucket)
+
+	key := fileKey(rec.path, rec.inode)
+
+	first := rec.scanID
+	if v := files.Get(key); v != nil {
+		var existing boltFile
+		if err := json.Unmarshal(v, &existing); err == nil {
+			first = existing.FirstSeenScan
+		}
+	}
+
+	bf := boltFile{
+		Size:          rec.size,
+		ModTime:       rec.modTime,
+		BirthTime:     rec.birthTime,
+		Inode:         rec.inode,
+		Hash:          rec.hash,
+		Status:        rec.status,
+		FirstSeenScan: first,
+		LastSeenScan:  rec.scanID,
+	}
+
+	data, err := json.Marshal(bf)
+	if err != nil {
+		return fmt.Errorf("error encoding %q: %v", rec.path, err)
+	}
+	if err := files.Put(key, data); err != nil {
+		return fmt.Errorf("error writing %q: %v", rec.path, err)
+	}
+
+	return nil
+}
+
+func (b *boltBatch) Commit() error {
+	return b.tx.Commit()
+}
+
+func scanKey(scanID int64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(scanID))
+	return buf
+}
+
+func fileKey(path string, inode uint64) []byte {
+	buf := make([]byte, 8+len(path))
+	binary.BigEndian.PutUint64(buf[:8], inode)
+	copy(buf[8:], path)
+	return buf
+}
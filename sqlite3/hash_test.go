@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseHashMode(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    hashMode
+		wantErr bool
+	}{
+		{"none", hashNone, false},
+		{"size", hashSize, false},
+		{"sha256", hashSHA256, false},
+		{"blake3", hashBlake3, false},
+		{"md5", "", true},
+		{"", "", true},
+	}
+
+	for _, c := range cases {
+		got, err := parseHashMode(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("parseHashMode(%q): expected an error, got %q", c.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseHashMode(%q): unexpected error: %v", c.in, err)
+		}
+		if got != c.want {
+			t.Errorf("parseHashMode(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f.txt")
+	if err := os.WriteFile(path, []byte("hello world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []hashMode{hashNone, hashSize, hashSHA256, hashBlake3} {
+		got, err := hashFile(path, mode)
+		if err != nil {
+			t.Fatalf("hashFile(%s): %v", mode, err)
+		}
+
+		switch mode {
+		case hashNone, hashSize:
+			if got != "" {
+				t.Errorf("hashFile(%s) = %q, want empty string", mode, got)
+			}
+		default:
+			if got == "" {
+				t.Errorf("hashFile(%s): expected a non-empty hash", mode)
+			}
+		}
+	}
+}
+
+func TestHashFileStableAndDistinct(t *testing.T) {
+	dir := t.TempDir()
+	pathA := filepath.Join(dir, "a.txt")
+	pathB := filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(pathA, []byte("same content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pathB, []byte("different content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []hashMode{hashSHA256, hashBlake3} {
+		first, err := hashFile(pathA, mode)
+		if err != nil {
+			t.Fatalf("hashFile(%s): %v", mode, err)
+		}
+		second, err := hashFile(pathA, mode)
+		if err != nil {
+			t.Fatalf("hashFile(%s): %v", mode, err)
+		}
+		if first != second {
+			t.Errorf("hashFile(%s) not stable across calls: %q != %q", mode, first, second)
+		}
+
+		other, err := hashFile(pathB, mode)
+		if err != nil {
+			t.Fatalf("hashFile(%s): %v", mode, err)
+		}
+		if first == other {
+			t.Errorf("hashFile(%s) produced the same hash for different content", mode)
+		}
+	}
+}
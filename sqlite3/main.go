@@ -2,7 +2,7 @@
 // Written using Claude from Anthropic - 2024-12-26
 // This was written to test how fast a Raspberry Pi 4 B could write to a SQLite3 database that sits on an SD card
 // By default, pragmas are setup wrong for speed, but correct for data recovery in case of failures, which wasn't a required test
-// Running a scan on the /usr directory netted me about 120k files put into the database.  
+// Running a scan on the /usr directory netted me about 120k files put into the database.
 // Without the pragmas set below, 17k entries were put into the database in about 5 minutes.
 // With the pragmas, 130k were in (Dupes included) within 5 seconds
 // @raspberrypi:~/go/dirscan $ time ./dirscan /usr/ dirscan.db3
@@ -10,147 +10,191 @@
 // real    0m4.142s
 // user    0m2.808s
 // sys     0m1.405s
+//
+// --rescan reuses an existing database and classifies files as
+// new/modified/unchanged/deleted instead of appending duplicate rows.
 
 package main
 
 import (
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
-	"syscall"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-func initDB(dbPath string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		return nil, fmt.Errorf("error opening database: %v", err)
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "backup":
+			runBackup(os.Args[2:])
+			return
+		case "restore":
+			runRestore(os.Args[2:])
+			return
+		}
 	}
+	runScan(os.Args[1:])
+}
 
-	// Set performance parameters
-	_, err = db.Exec(`PRAGMA synchronous = OFF`)
-	if err != nil {
-		return nil, fmt.Errorf("error setting synchronous pragma: %v", err)
+// runBackup implements `dirscan backup <db> <out.sql.zst>`.
+func runBackup(args []string) {
+	if len(args) != 2 {
+		log.Fatal("Usage: dirscan backup <db> <out.sql.zst>")
 	}
-	
-	_, err = db.Exec(`PRAGMA journal_mode = MEMORY`)
+	dbPath, outPath := args[0], args[1]
+
+	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
-		return nil, fmt.Errorf("error setting journal_mode pragma: %v", err)
+		log.Fatalf("Failed to open database: %v", err)
 	}
+	defer db.Close()
 
-	_, err = db.Exec(`PRAGMA cache_size = 100000`)
+	out, err := os.Create(outPath)
 	if err != nil {
-		return nil, fmt.Errorf("error setting cache_size pragma: %v", err)
+		log.Fatalf("Failed to create %s: %v", outPath, err)
 	}
+	defer out.Close()
 
-	// Create the files table if it doesn't exist
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS files (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		filepath TEXT NOT NULL,
-		filename TEXT NOT NULL,
-		size INTEGER NOT NULL,
-		modified_time DATETIME NOT NULL,
-		created_time DATETIME NOT NULL
-	);`
-
-	_, err = db.Exec(createTableSQL)
-	if err != nil {
-		return nil, fmt.Errorf("error creating table: %v", err)
+	if err := backupDB(db, out); err != nil {
+		log.Fatalf("Error backing up database: %v", err)
 	}
 
-	return db, nil
+	fmt.Println("Backup completed successfully")
 }
 
-func scanDirectory(path string, db *sql.DB) error {
-	// Start a transaction
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("error starting transaction: %v", err)
+// runRestore implements `dirscan restore <in.sql.zst> <db>`.
+func runRestore(args []string) {
+	if len(args) != 2 {
+		log.Fatal("Usage: dirscan restore <in.sql.zst> <db>")
 	}
-	defer tx.Rollback() // Will rollback if not committed
+	inPath, dbPath := args[0], args[1]
 
-	// Prepare the insert statement once for the whole transaction
-	stmt, err := tx.Prepare(`
-		INSERT INTO files (filepath, filename, size, modified_time, created_time)
-		VALUES (?, ?, ?, ?, ?)
-	`)
-	if err != nil {
-		return fmt.Errorf("error preparing statement: %v", err)
+	if _, err := os.Stat(dbPath); err == nil {
+		log.Fatalf("%s already exists; restore writes into a fresh database", dbPath)
 	}
-	defer stmt.Close()
 
-	err = filepath.Walk(path, func(filepath string, info os.FileInfo, err error) error {
-		if err != nil {
-			return fmt.Errorf("error accessing path %q: %v", filepath, err)
-		}
+	in, err := os.Open(inPath)
+	if err != nil {
+		log.Fatalf("Failed to open %s: %v", inPath, err)
+	}
+	defer in.Close()
 
-		// Skip directories
-		if info.IsDir() {
-			return nil
-		}
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
 
-		// Get file creation time (birth time) or modification time if creation time is not available
-		var birthTime time.Time
-		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
-			// On Linux, birth time might not be available, falling back to ctime
-			birthTime = time.Unix(stat.Ctim.Sec, stat.Ctim.Nsec)
-		} else {
-			// Fallback to modification time if we can't get creation time
-			birthTime = info.ModTime()
-		}
+	if err := restoreDB(db, in); err != nil {
+		log.Fatalf("Error restoring database: %v", err)
+	}
 
-		// Execute the insert
-		_, err = stmt.Exec(
-			filepath,
-			info.Name(),
-			info.Size(),
-			info.ModTime(),
-			birthTime,
-		)
-		if err != nil {
-			return fmt.Errorf("error inserting record for %q: %v", filepath, err)
-		}
+	fmt.Println("Restore completed successfully")
+}
 
-		return nil
-	})
+// runScan implements the default `dirscan [flags] <directory> <db>` scan.
+func runScan(args []string) {
+	fs := flag.NewFlagSet("dirscan", flag.ExitOnError)
+	rescan := fs.Bool("rescan", false, "reuse the existing database and only record what changed since the last scan")
+	hashFlag := fs.String("hash", "size", "content change detection: none, size, sha256, or blake3")
+	workers := fs.Int("workers", 4, "number of worker goroutines walking directories and hashing files concurrently")
+	batchSize := fs.Int("batch-size", 5000, "number of file records accumulated before each write transaction")
+	commitInterval := fs.Duration("commit-interval", 5*time.Second, "flush a partial batch after this long even if it hasn't filled up")
+	backend := fs.String("backend", "sqlite", "storage backend: sqlite or bbolt")
+	metricsAddr := fs.String("metrics-addr", "", "if set, serve expvar metrics on this address (e.g. :9090)")
+	openWarn := fs.Duration("open-warn-threshold", 2*time.Second, "log a warning if opening the store takes longer than this")
+	sizeWarn := fs.Int64("size-warn-threshold", 1<<30, "log a warning if the database file is already larger than this many bytes at open")
+	backupTo := fs.String("backup-to", "", "after a successful scan, ship a compressed online backup to file://<dir> or s3://<bucket>/<prefix> (sqlite backend only)")
+	backupCompression := fs.String("backup-compression", "zstd", "compression for --backup-to: gzip or zstd")
+	backupKeep := fs.Int("backup-keep", 7, "number of backups to retain under --backup-to; older ones are pruned")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		log.Fatal("Usage: dirscan [--rescan] [--hash=none|size|sha256|blake3] [--workers=N] <directory_path> <database_path>")
+	}
+	dirPath := fs.Arg(0)
+	dbPath := fs.Arg(1)
 
+	mode, err := parseHashMode(*hashFlag)
 	if err != nil {
-		return err
+		log.Fatal(err)
 	}
 
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("error committing transaction: %v", err)
+	if !*rescan {
+		if _, err := os.Stat(dbPath); err == nil {
+			log.Fatalf("%s already exists; pass --rescan to scan into it incrementally", dbPath)
+		}
 	}
 
-	return nil
-}
+	serveMetrics(*metricsAddr)
 
-func main() {
-	if len(os.Args) != 3 {
-		log.Fatal("Usage: program <directory_path> <database_path>")
+	if info, statErr := os.Stat(dbPath); statErr == nil && info.Size() > *sizeWarn {
+		log.Printf("warning: %s is %d bytes, exceeding the %d byte size-warn threshold", dbPath, info.Size(), *sizeWarn)
+	}
+
+	// Initialize the storage backend
+	openStart := time.Now()
+	store, err := openStore(*backend, dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open store: %v", err)
 	}
+	defer store.Close()
 
-	dirPath := os.Args[1]
-	dbPath := os.Args[2]
+	openElapsed := time.Since(openStart)
+	metricOpenDurationMs.Set(openElapsed.Milliseconds())
+	if openElapsed > *openWarn {
+		log.Printf("warning: opening %s took %s, exceeding the %s open-warn threshold", dbPath, openElapsed, *openWarn)
+	}
 
-	// Initialize database
-	db, err := initDB(dbPath)
+	scanID, err := store.StartScan(dirPath)
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		log.Fatalf("Failed to start scan: %v", err)
 	}
-	defer db.Close()
 
 	// Scan directory and store file information
-	err = scanDirectory(dirPath, db)
+	err = scanDirectory(dirPath, store, scanID, scanOptions{
+		hash:           mode,
+		workers:        *workers,
+		batchSize:      *batchSize,
+		commitInterval: *commitInterval,
+	})
 	if err != nil {
 		log.Fatalf("Error scanning directory: %v", err)
 	}
 
+	if err := store.FinishScan(scanID); err != nil {
+		log.Fatalf("Error finishing scan: %v", err)
+	}
+
+	logScanSummary(store, scanID)
+
+	if *backupTo != "" {
+		ss, ok := store.(*sqliteStore)
+		if !ok {
+			log.Printf("warning: --backup-to requires --backend=sqlite; skipping backup")
+		} else if err := performBackup(ss.underlyingDB(), *backupTo, *backupCompression, *backupKeep); err != nil {
+			log.Printf("warning: backup failed: %v", err)
+		}
+	}
+
 	fmt.Println("Directory scan completed successfully")
 }
+
+// logScanSummary reports how many files fell into each status bucket for
+// scanID, via Store.CountByStatus, so a cron-job caller gets signal about
+// what changed without having to query the database itself.
+func logScanSummary(store Store, scanID int64) {
+	for _, status := range []string{"new", "modified", "unchanged", "deleted"} {
+		count, err := store.CountByStatus(scanID, status)
+		if err != nil {
+			log.Printf("warning: could not count %q files: %v", status, err)
+			continue
+		}
+		log.Printf("%s: %d", status, count)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+)
+
+// Exported via expvar so a cron-job deployment can scrape /debug/vars
+// instead of someone having to instrument dirscan externally.
+var (
+	metricFilesScanned   = expvar.NewInt("files_scanned")
+	metricBytesScanned   = expvar.NewInt("bytes_scanned")
+	metricInsertErrors   = expvar.NewInt("insert_errors")
+	metricWalkErrors     = expvar.NewInt("walk_errors")
+	metricOpenDurationMs = expvar.NewInt("open_duration_ms")
+	metricCommitDuration = expvar.NewInt("commit_duration_ms")
+)
+
+// serveMetrics starts an HTTP server exposing the expvar counters above at
+// /debug/vars. It's fire-and-forget: a failure here (e.g. the address is
+// already in use) is logged but never fails the scan itself.
+func serveMetrics(addr string) {
+	if addr == "" {
+		return
+	}
+	go func() {
+		log.Printf("serving metrics on http://%s/debug/vars", addr)
+		if err := http.ListenAndServe(addr, nil); err != nil {
+			log.Printf("metrics server stopped: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// scanStats holds the running totals a scan reports progress from. All
+// fields are updated with atomic ops since the hashing workers and the
+// progress logger touch them concurrently.
+type scanStats struct {
+	filesScanned int64
+	bytesScanned int64
+}
+
+func (s *scanStats) recordFile(size int64) {
+	atomic.AddInt64(&s.filesScanned, 1)
+	atomic.AddInt64(&s.bytesScanned, size)
+	metricFilesScanned.Add(1)
+	metricBytesScanned.Add(size)
+}
+
+// logProgress logs files/sec, MB/sec, and the pending-work queue depth
+// every interval until stop is closed.
+func logProgress(stats *scanStats, queueDepth func() int, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastFiles, lastBytes int64
+	lastAt := time.Now()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			files := atomic.LoadInt64(&stats.filesScanned)
+			bytes := atomic.LoadInt64(&stats.bytesScanned)
+			elapsed := now.Sub(lastAt).Seconds()
+			if elapsed <= 0 {
+				elapsed = interval.Seconds()
+			}
+
+			filesPerSec := float64(files-lastFiles) / elapsed
+			mbPerSec := float64(bytes-lastBytes) / (1024 * 1024) / elapsed
+
+			log.Printf("progress: %d files scanned (%.1f files/sec, %.2f MB/sec, queue depth %d)",
+				files, filesPerSec, mbPerSec, queueDepth())
+
+			lastFiles, lastBytes, lastAt = files, bytes, now
+		}
+	}
+}
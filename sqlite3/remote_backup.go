@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/klauspost/compress/zstd"
+	"github.com/mattn/go-sqlite3"
+)
+
+// backupTimeLayout sorts lexically the same as chronologically, so
+// pruning backups by filename needs no parsing.
+const backupTimeLayout = "20060102-150405"
+
+// performBackup snapshots db via SQLite's online backup API (a live
+// copy, safe to run against a database still being written to) and
+// ships a compressed copy to target, which is either file://<dir> or
+// s3://<bucket>/<prefix>. Older backups beyond keep are pruned.
+func performBackup(db *sql.DB, target, compression string, keep int) error {
+	snapshotPath, cleanup, err := snapshotDB(db)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	ext := "zst"
+	if compression == "gzip" {
+		ext = "gz"
+	}
+	key := fmt.Sprintf("dirscan-%s.db.%s", time.Now().UTC().Format(backupTimeLayout), ext)
+
+	switch {
+	case strings.HasPrefix(target, "file://"):
+		return backupToFile(snapshotPath, strings.TrimPrefix(target, "file://"), key, compression, keep)
+	case strings.HasPrefix(target, "s3://"):
+		rest := strings.TrimPrefix(target, "s3://")
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		return backupToS3(snapshotPath, bucket, prefix, key, compression, keep)
+	default:
+		return fmt.Errorf("--backup-to must start with file:// or s3://, got %q", target)
+	}
+}
+
+// snapshotDB copies db into a fresh temp file using SQLite's Backup API
+// rather than a raw file copy, so the result is consistent even while a
+// scan's writer goroutine is still committing. The caller must invoke the
+// returned cleanup func once done with the file.
+func snapshotDB(db *sql.DB) (string, func(), error) {
+	tmp, err := os.CreateTemp("", "dirscan-backup-*.db")
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating backup temp file: %v", err)
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	os.Remove(tmpPath) // sqlite3 must create the destination file itself
+	cleanup := func() { os.Remove(tmpPath) }
+
+	destDB, err := sql.Open("sqlite3", tmpPath)
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("error opening backup destination: %v", err)
+	}
+	defer destDB.Close()
+
+	ctx := context.Background()
+	srcConn, err := db.Conn(ctx)
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("error acquiring source connection: %v", err)
+	}
+	defer srcConn.Close()
+
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("error acquiring backup destination connection: %v", err)
+	}
+	defer destConn.Close()
+
+	err = srcConn.Raw(func(srcDriverConn interface{}) error {
+		return destConn.Raw(func(destDriverConn interface{}) error {
+			sc := srcDriverConn.(*sqlite3.SQLiteConn)
+			dc := destDriverConn.(*sqlite3.SQLiteConn)
+
+			b, err := sc.Backup("main", dc, "main")
+			if err != nil {
+				return fmt.Errorf("error starting online backup: %v", err)
+			}
+			defer b.Finish()
+
+			if _, err := b.Step(-1); err != nil {
+				return fmt.Errorf("error running online backup: %v", err)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	return tmpPath, cleanup, nil
+}
+
+// compressSnapshot streams the snapshot at snapshotPath through gzip or
+// zstd (the repo's default) into w.
+func compressSnapshot(snapshotPath, compression string, w io.Writer) error {
+	f, err := os.Open(snapshotPath)
+	if err != nil {
+		return fmt.Errorf("error opening snapshot: %v", err)
+	}
+	defer f.Close()
+
+	if compression == "gzip" {
+		gw := gzip.NewWriter(w)
+		if _, err := io.Copy(gw, f); err != nil {
+			return fmt.Errorf("error compressing snapshot: %v", err)
+		}
+		return gw.Close()
+	}
+
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return fmt.Errorf("error creating zstd writer: %v", err)
+	}
+	if _, err := io.Copy(zw, f); err != nil {
+		return fmt.Errorf("error compressing snapshot: %v", err)
+	}
+	return zw.Close()
+}
+
+func backupToFile(snapshotPath, dir, key, compression string, keep int) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating backup directory %q: %v", dir, err)
+	}
+
+	outPath := filepath.Join(dir, key)
+	out, err := os.Create(outPath)
+	if err != nil {
+		return fmt.Errorf("error creating backup file %q: %v", outPath, err)
+	}
+	defer out.Close()
+
+	if err := compressSnapshot(snapshotPath, compression, out); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("error listing backup directory %q: %v", dir, err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), "dirscan-") {
+			names = append(names, e.Name())
+		}
+	}
+	for _, name := range backupsToPrune(names, keep) {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return fmt.Errorf("error pruning old backup %q: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+func backupToS3(snapshotPath, bucket, prefix, key, compression string, keep int) error {
+	var buf bytes.Buffer
+	if err := compressSnapshot(snapshotPath, compression, &buf); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("error loading AWS config: %v", err)
+	}
+	client := s3.NewFromConfig(cfg)
+
+	objectKey := path.Join(prefix, key)
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(objectKey),
+		Body:   bytes.NewReader(buf.Bytes()),
+	})
+	if err != nil {
+		return fmt.Errorf("error uploading backup to s3://%s/%s: %v", bucket, objectKey, err)
+	}
+
+	list, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(path.Join(prefix, "dirscan-")),
+	})
+	if err != nil {
+		return fmt.Errorf("error listing existing backups: %v", err)
+	}
+	var names []string
+	for _, obj := range list.Contents {
+		names = append(names, path.Base(aws.ToString(obj.Key)))
+	}
+	for _, name := range backupsToPrune(names, keep) {
+		_, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(path.Join(prefix, name)),
+		})
+		if err != nil {
+			return fmt.Errorf("error pruning old backup %q: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// backupsToPrune returns the names beyond the newest keep, oldest first.
+// Names sort chronologically because they embed backupTimeLayout
+// timestamps.
+func backupsToPrune(names []string, keep int) []string {
+	if keep <= 0 || len(names) <= keep {
+		return nil
+	}
+	sort.Strings(names)
+	return names[:len(names)-keep]
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBackupsToPrune(t *testing.T) {
+	names := []string{
+		"dirscan-20260103-000000.db.zst",
+		"dirscan-20260101-000000.db.zst",
+		"dirscan-20260102-000000.db.zst",
+		"dirscan-20260104-000000.db.zst",
+	}
+
+	cases := []struct {
+		name string
+		keep int
+		want []string
+	}{
+		{"keeps newest two", 2, []string{"dirscan-20260101-000000.db.zst", "dirscan-20260102-000000.db.zst"}},
+		{"keeps everything when under the limit", 10, nil},
+		{"keep of zero prunes nothing", 0, nil},
+		{"negative keep prunes nothing", -1, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := backupsToPrune(append([]string(nil), names...), c.keep)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("backupsToPrune(keep=%d) = %v, want %v", c.keep, got, c.want)
+			}
+		})
+	}
+}
+
+func TestBackupsToPruneKeepsExactCount(t *testing.T) {
+	names := []string{
+		"dirscan-20260101-000000.db.zst",
+		"dirscan-20260102-000000.db.zst",
+		"dirscan-20260103-000000.db.zst",
+	}
+
+	pruned := backupsToPrune(names, 3)
+	if pruned != nil {
+		t.Errorf("backupsToPrune with len(names) == keep should prune nothing, got %v", pruned)
+	}
+}
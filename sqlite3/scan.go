@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// fileRecord is what a hashing worker produces for one path and what the
+// writer goroutine turns into a row.
+type fileRecord struct {
+	path      string
+	name      string
+	size      int64
+	modTime   time.Time
+	birthTime time.Time
+	inode     uint64
+	hash      string
+	status    string
+	scanID    int64
+}
+
+// scanOptions controls how scanDirectory walks, batches, and reports on a
+// scan.
+type scanOptions struct {
+	hash           hashMode
+	workers        int
+	batchSize      int
+	commitInterval time.Duration
+}
+
+// scanDirectory concurrently walks path, hashes and classifies files
+// against the previous scan (if any), and writes the results under
+// scanID. opts.workers goroutines fan out the directory walk and another
+// opts.workers do the stat+hash work; a single writer goroutine flushes accumulated
+// records in opts.batchSize-sized transactions (or every
+// opts.commitInterval, whichever comes first) so a crash mid-scan loses
+// at most one batch instead of the whole run.
+func scanDirectory(path string, store Store, scanID int64, opts scanOptions) error {
+	if opts.workers < 1 {
+		opts.workers = 1
+	}
+	if opts.batchSize < 1 {
+		opts.batchSize = 5000
+	}
+	if opts.commitInterval <= 0 {
+		opts.commitInterval = 5 * time.Second
+	}
+
+	paths := make(chan string, opts.workers*4)
+	records := make(chan fileRecord, opts.workers*4)
+	workerErrs := make(chan error, 4096)
+
+	stats := &scanStats{}
+	stop := make(chan struct{})
+	go logProgress(stats, func() int { return len(paths) }, opts.commitInterval, stop)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- writeRecords(store, records, opts.batchSize, opts.commitInterval)
+	}()
+
+	// Collect worker errors as they arrive instead of after the workers
+	// finish: a worker that hits an error keeps ranging over paths, so
+	// workerErrs has to stay drained while workers are still running, or
+	// a worker blocks forever on workerErrs <- err and never returns.
+	var firstWorkerErr error
+	workerErrsDone := make(chan struct{})
+	go func() {
+		defer close(workerErrsDone)
+		for err := range workerErrs {
+			if firstWorkerErr == nil {
+				firstWorkerErr = err
+			}
+		}
+	}()
+
+	var workersDone sync.WaitGroup
+	workersDone.Add(opts.workers)
+	for i := 0; i < opts.workers; i++ {
+		go func() {
+			defer workersDone.Done()
+			for p := range paths {
+				rec, err := buildRecord(store, p, scanID, opts.hash)
+				if err != nil {
+					workerErrs <- err
+					continue
+				}
+				stats.recordFile(rec.size)
+				records <- rec
+			}
+		}()
+	}
+
+	werr := walkConcurrent(path, opts.workers, paths)
+	close(paths)
+
+	workersDone.Wait()
+	close(records)
+	close(workerErrs)
+	<-workerErrsDone
+	close(stop)
+
+	if werr != nil {
+		<-done
+		return werr
+	}
+	if firstWorkerErr != nil {
+		<-done
+		return firstWorkerErr
+	}
+
+	return <-done
+}
+
+// buildRecord stats (and, if needed, hashes) a single file and decides
+// its status by comparing against the most recently recorded state of
+// the same (filepath, inode).
+func buildRecord(store Store, path string, scanID int64, mode hashMode) (fileRecord, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileRecord{}, fmt.Errorf("error stating %q: %v", path, err)
+	}
+
+	var inode uint64
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		inode = stat.Ino
+	}
+
+	var birthTime time.Time
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		birthTime = time.Unix(stat.Ctim.Sec, stat.Ctim.Nsec)
+	} else {
+		birthTime = info.ModTime()
+	}
+
+	rec := fileRecord{
+		path:      path,
+		name:      info.Name(),
+		size:      info.Size(),
+		modTime:   info.ModTime(),
+		birthTime: birthTime,
+		inode:     inode,
+		scanID:    scanID,
+	}
+
+	prev, found, err := store.FindFile(path, inode)
+	switch {
+	case !found && err == nil:
+		rec.status = "new"
+	case err != nil:
+		return fileRecord{}, err
+	case prev.size == rec.size && prev.modTime.Equal(rec.modTime):
+		rec.status = "unchanged"
+		rec.hash = prev.hash
+		return rec, nil
+	default:
+		rec.status = "modified"
+	}
+
+	hash, err := hashFile(path, mode)
+	if err != nil {
+		return fileRecord{}, err
+	}
+	rec.hash = hash
+
+	return rec, nil
+}
+
+// writeRecords owns the write side of a scan. It batches records into
+// groups of batchSize, flushing a batch early if commitInterval elapses
+// before it fills up so a long tail of slow hashing doesn't hold an
+// open transaction indefinitely.
+func writeRecords(store Store, records <-chan fileRecord, batchSize int, commitInterval time.Duration) error {
+	batch, err := store.BeginBatch()
+	if err != nil {
+		return err
+	}
+	pending := 0
+
+	ticker := time.NewTicker(commitInterval)
+	defer ticker.Stop()
+
+	// commit flushes the currently open batch in place, without starting
+	// a new one - the caller decides whether a replacement batch is
+	// needed. It always commits, even with nothing pending: the batch
+	// is open regardless, and for a backend like bbolt whose BeginBatch
+	// takes a single-writer lock, an uncommitted batch never releases
+	// it, deadlocking the FinishScan call that follows.
+	commit := func() error {
+		start := time.Now()
+		if err := batch.Commit(); err != nil {
+			return err
+		}
+		if pending > 0 {
+			metricCommitDuration.Add(time.Since(start).Milliseconds())
+		}
+		pending = 0
+		return nil
+	}
+
+	// flush commits the current batch and opens a fresh one to keep
+	// accepting records. Only call this mid-scan: the final commit, once
+	// records is drained, must not reopen a batch nobody will ever
+	// commit or close.
+	flush := func() error {
+		if err := commit(); err != nil {
+			return err
+		}
+		batch, err = store.BeginBatch()
+		return err
+	}
+
+	for {
+		select {
+		case rec, ok := <-records:
+			if !ok {
+				return commit()
+			}
+			if err := batch.PutFile(rec); err != nil {
+				metricInsertErrors.Add(1)
+				return err
+			}
+			pending++
+			if pending >= batchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			if pending == 0 {
+				continue
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
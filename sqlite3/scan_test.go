@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeStore is a minimal in-memory Store used to observe how writeRecords
+// opens and commits batches, without pulling in a real backend.
+type fakeStore struct {
+	opened    int
+	committed int
+}
+
+func (s *fakeStore) StartScan(root string) (int64, error)                       { return 1, nil }
+func (s *fakeStore) FinishScan(scanID int64) error                              { return nil }
+func (s *fakeStore) FindFile(path string, inode uint64) (existingFile, bool, error) {
+	return existingFile{}, false, nil
+}
+func (s *fakeStore) CountByStatus(scanID int64, status string) (int, error) { return 0, nil }
+func (s *fakeStore) Close() error                                           { return nil }
+
+func (s *fakeStore) BeginBatch() (Batch, error) {
+	s.opened++
+	return &fakeBatch{store: s}, nil
+}
+
+// fakeBatch records its Commit exactly once and returns an error on a double
+// commit, so a reopened-but-never-committed (or double-committed) batch fails loud.
+type fakeBatch struct {
+	store     *fakeStore
+	committed bool
+}
+
+func (b *fakeBatch) PutFile(rec fileRecord) error { return nil }
+
+func (b *fakeBatch) Commit() error {
+	if b.committed {
+		return fmt.Errorf("batch committed twice")
+	}
+	b.committed = true
+	b.store.committed++
+	return nil
+}
+
+// TestWriteRecordsNeverLeavesABatchOpen guards against a regression of the
+// bug where the terminal flush, once the records channel closed, reopened a
+// fresh batch nobody would ever commit - fatal for a backend like bbolt
+// whose BeginBatch takes the single-writer lock for the life of the batch.
+func TestWriteRecordsNeverLeavesABatchOpen(t *testing.T) {
+	store := &fakeStore{}
+	records := make(chan fileRecord, 10)
+	for i := 0; i < 10; i++ {
+		records <- fileRecord{path: fmt.Sprintf("/f%d", i)}
+	}
+	close(records)
+
+	if err := writeRecords(store, records, 3, time.Hour); err != nil {
+		t.Fatalf("writeRecords: %v", err)
+	}
+
+	if store.opened != store.committed {
+		t.Errorf("opened %d batches but committed %d - a batch was left open", store.opened, store.committed)
+	}
+}
+
+// TestWriteRecordsEmptyChannelCommitsOnce covers the empty-scan case: the
+// very first batch BeginBatch opens must still be committed, never left
+// open, even though no record ever arrives.
+func TestWriteRecordsEmptyChannelCommitsOnce(t *testing.T) {
+	store := &fakeStore{}
+	records := make(chan fileRecord)
+	close(records)
+
+	if err := writeRecords(store, records, 3, time.Hour); err != nil {
+		t.Fatalf("writeRecords: %v", err)
+	}
+
+	if store.opened != 1 || store.committed != 1 {
+		t.Errorf("opened=%d committed=%d, want 1 and 1", store.opened, store.committed)
+	}
+}
+
+// TestScanDirectoryDrainsWorkerErrorsWithoutDeadlock guards against a
+// regression of the workerErrs deadlock: several broken symlinks failing
+// os.Stat concurrently used to block every worker writing to workerErrs
+// because nothing drained it until all workers had already finished.
+func TestScanDirectoryDrainsWorkerErrorsWithoutDeadlock(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 12; i++ {
+		link := filepath.Join(dir, fmt.Sprintf("broken%d", i))
+		if err := os.Symlink(filepath.Join(dir, "does-not-exist"), link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, err := openStore("sqlite", filepath.Join(t.TempDir(), "scan.db3"))
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	defer store.Close()
+
+	scanID, err := store.StartScan(dir)
+	if err != nil {
+		t.Fatalf("StartScan: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- scanDirectory(dir, store, scanID, scanOptions{hash: hashSize, workers: 4, batchSize: 5000, commitInterval: time.Hour})
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("scanDirectory: expected an error from the broken symlinks")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("scanDirectory did not return within 10s - possible deadlock draining workerErrs")
+	}
+}
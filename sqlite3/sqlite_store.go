@@ -0,0 +1,216 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// sqliteStore is the original SQLite-backed Store.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// openSQLiteStore opens (or creates) the SQLite database at dbPath,
+// applies the speed-over-durability pragmas, and makes sure the schema is
+// up to date.
+func openSQLiteStore(dbPath string) (Store, error) {
+	// _busy_timeout makes SQLITE_BUSY waits instead of failing
+	// immediately: database/sql hands out a fresh connection per
+	// goroutine from its pool, so a FindFile read can easily land on a
+	// connection that races the writer's batch transaction for the lock.
+	// Without this, that race surfaces as "database is locked" the first
+	// time enough workers run concurrently.
+	db, err := sql.Open("sqlite3", dbPath+"?_busy_timeout=10000")
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %v", err)
+	}
+
+	// Set performance parameters
+	_, err = db.Exec(`PRAGMA synchronous = OFF`)
+	if err != nil {
+		return nil, fmt.Errorf("error setting synchronous pragma: %v", err)
+	}
+
+	_, err = db.Exec(`PRAGMA journal_mode = MEMORY`)
+	if err != nil {
+		return nil, fmt.Errorf("error setting journal_mode pragma: %v", err)
+	}
+
+	_, err = db.Exec(`PRAGMA cache_size = 100000`)
+	if err != nil {
+		return nil, fmt.Errorf("error setting cache_size pragma: %v", err)
+	}
+
+	if err := createSchema(db); err != nil {
+		return nil, err
+	}
+
+	return &sqliteStore{db: db}, nil
+}
+
+// createSchema creates the scans/files tables if they don't already exist.
+// scans records one row per scan run; files is keyed by
+// (filepath, inode) so a rescan can tell new/modified/unchanged/deleted
+// apart instead of blindly inserting duplicates.
+func createSchema(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS scans (
+		scan_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		root TEXT NOT NULL,
+		started_at DATETIME NOT NULL,
+		finished_at DATETIME
+	);`)
+	if err != nil {
+		return fmt.Errorf("error creating scans table: %v", err)
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS files (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		filepath TEXT NOT NULL,
+		filename TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		modified_time DATETIME NOT NULL,
+		created_time DATETIME NOT NULL,
+		inode INTEGER NOT NULL,
+		content_hash TEXT,
+		first_seen_scan INTEGER NOT NULL,
+		last_seen_scan INTEGER NOT NULL,
+		status TEXT NOT NULL,
+		FOREIGN KEY (first_seen_scan) REFERENCES scans(scan_id),
+		FOREIGN KEY (last_seen_scan) REFERENCES scans(scan_id)
+	);`)
+	if err != nil {
+		return fmt.Errorf("error creating files table: %v", err)
+	}
+
+	_, err = db.Exec(`
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_files_path_inode ON files(filepath, inode);`)
+	if err != nil {
+		return fmt.Errorf("error creating files index: %v", err)
+	}
+
+	return nil
+}
+
+func (s *sqliteStore) StartScan(root string) (int64, error) {
+	res, err := s.db.Exec(`INSERT INTO scans (root, started_at) VALUES (?, CURRENT_TIMESTAMP)`, root)
+	if err != nil {
+		return 0, fmt.Errorf("error starting scan: %v", err)
+	}
+	return res.LastInsertId()
+}
+
+func (s *sqliteStore) FinishScan(scanID int64) error {
+	_, err := s.db.Exec(`UPDATE scans SET finished_at = CURRENT_TIMESTAMP WHERE scan_id = ?`, scanID)
+	if err != nil {
+		return fmt.Errorf("error finishing scan: %v", err)
+	}
+
+	_, err = s.db.Exec(`UPDATE files SET status = 'deleted' WHERE last_seen_scan != ? AND status != 'deleted'`, scanID)
+	if err != nil {
+		return fmt.Errorf("error marking deleted files: %v", err)
+	}
+
+	return nil
+}
+
+func (s *sqliteStore) FindFile(path string, inode uint64) (existingFile, bool, error) {
+	var ef existingFile
+	var hash sql.NullString
+	err := s.db.QueryRow(`
+		SELECT size, modified_time, content_hash FROM files
+		WHERE filepath = ? AND inode = ?
+	`, path, inode).Scan(&ef.size, &ef.modTime, &hash)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return existingFile{}, false, nil
+	case err != nil:
+		return existingFile{}, false, fmt.Errorf("error looking up %q: %v", path, err)
+	}
+
+	ef.hash = hash.String
+	return ef, true, nil
+}
+
+func (s *sqliteStore) CountByStatus(scanID int64, status string) (int, error) {
+	var query string
+	var args []interface{}
+	if status == "deleted" {
+		query = `SELECT COUNT(*) FROM files WHERE status = ?`
+		args = []interface{}{status}
+	} else {
+		query = `SELECT COUNT(*) FROM files WHERE last_seen_scan = ? AND status = ?`
+		args = []interface{}{scanID, status}
+	}
+
+	var count int
+	if err := s.db.QueryRow(query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting %q files: %v", status, err)
+	}
+	return count, nil
+}
+
+func (s *sqliteStore) BeginBatch() (Batch, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO files (filepath, filename, size, modified_time, created_time, inode, content_hash, first_seen_scan, last_seen_scan, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(filepath, inode) DO UPDATE SET
+			size = excluded.size,
+			modified_time = excluded.modified_time,
+			content_hash = excluded.content_hash,
+			last_seen_scan = excluded.last_seen_scan,
+			status = excluded.status
+	`)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error preparing upsert statement: %v", err)
+	}
+
+	return &sqliteBatch{tx: tx, upsert: stmt, scanID: -1}, nil
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+// underlyingDB exposes the raw *sql.DB so callers that need SQLite-only
+// functionality (like the online backup API) can reach past the Store
+// interface.
+func (s *sqliteStore) underlyingDB() *sql.DB {
+	return s.db
+}
+
+// sqliteBatch is a single transaction plus its prepared upsert statement.
+// PutFile tags each row with the record's own scanID; the scanID field
+// starts at -1 and is not updated.
+type sqliteBatch struct {
+	tx     *sql.Tx
+	upsert *sql.Stmt
+	scanID int64
+}
+
+func (b *sqliteBatch) PutFile(rec fileRecord) error {
+	_, err := b.upsert.Exec(
+		rec.path, rec.name, rec.size, rec.modTime, rec.birthTime, rec.inode,
+		rec.hash, rec.scanID, rec.scanID, rec.status,
+	)
+	if err != nil {
+		return fmt.Errorf("error writing record for %q: %v", rec.path, err)
+	}
+	return nil
+}
+
+func (b *sqliteBatch) Commit() error {
+	b.upsert.Close()
+	if err := b.tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// existingFile is what a Store returns when a caller asks whether it has
+// already seen a given (filepath, inode) pair.
+type existingFile struct {
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+// Store is the persistence backend a scan writes into. The default is
+// sqliteStore; boltStore trades SQLite's WAL/journal churn for bbolt's
+// mmap'd single-writer B+tree, which behaves more predictably on SD
+// cards. Both are driven the same way by scanDirectory.
+type Store interface {
+	// StartScan records the beginning of a scan of root and returns an
+	// identifier later records are tagged with.
+	StartScan(root string) (int64, error)
+
+	// FinishScan marks scanID as complete and marks any file not seen
+	// during it as deleted.
+	FinishScan(scanID int64) error
+
+	// FindFile looks up the most recently recorded state of the file at
+	// (path, inode), if any.
+	FindFile(path string, inode uint64) (existingFile, bool, error)
+
+	// CountByStatus reports how many files are recorded with status
+	// ("new", "modified", "unchanged", or "deleted") as of scanID. For
+	// "deleted" this counts every file ever marked deleted, since a
+	// deleted file's last_seen_scan stays pinned to the scan it was last
+	// present in, not the scan that noticed it was gone.
+	CountByStatus(scanID int64, status string) (int, error)
+
+	// BeginBatch opens a new write batch. Only one batch may be open on
+	// a Store at a time.
+	BeginBatch() (Batch, error)
+
+	Close() error
+}
+
+// Batch accumulates file records and flushes them together, so a scan
+// doesn't pay a commit per file.
+type Batch interface {
+	PutFile(rec fileRecord) error
+	Commit() error
+}
+
+// openStore opens the storage backend named by backend ("sqlite" or
+// "bbolt") at path, creating it if necessary.
+func openStore(backend, path string) (Store, error) {
+	switch backend {
+	case "", "sqlite":
+		return openSQLiteStore(path)
+	case "bbolt":
+		return openBoltStore(path)
+	default:
+		return nil, fmt.Errorf("unknown --backend %q (want sqlite or bbolt)", backend)
+	}
+}
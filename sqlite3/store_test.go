@@ -0,0 +1,134 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testStores runs fn against a freshly opened instance of every Store
+// backend, so a single test exercises sqliteStore and boltStore identically.
+func testStores(t *testing.T, fn func(t *testing.T, store Store)) {
+	t.Helper()
+	backends := []string{"sqlite", "bbolt"}
+	for _, backend := range backends {
+		backend := backend
+		t.Run(backend, func(t *testing.T) {
+			dbPath := filepath.Join(t.TempDir(), "dirscan.db")
+			store, err := openStore(backend, dbPath)
+			if err != nil {
+				t.Fatalf("openStore(%q): %v", backend, err)
+			}
+			defer store.Close()
+			fn(t, store)
+		})
+	}
+}
+
+func TestStoreScanLifecycle(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		scanID, err := store.StartScan("/data")
+		if err != nil {
+			t.Fatalf("StartScan: %v", err)
+		}
+
+		batch, err := store.BeginBatch()
+		if err != nil {
+			t.Fatalf("BeginBatch: %v", err)
+		}
+
+		now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		records := []fileRecord{
+			{path: "/data/a.txt", name: "a.txt", size: 10, modTime: now, birthTime: now, inode: 1, hash: "h1", scanID: scanID, status: "new"},
+			{path: "/data/b.txt", name: "b.txt", size: 20, modTime: now, birthTime: now, inode: 2, hash: "h2", scanID: scanID, status: "new"},
+		}
+		for _, rec := range records {
+			if err := batch.PutFile(rec); err != nil {
+				t.Fatalf("PutFile(%s): %v", rec.path, err)
+			}
+		}
+		if err := batch.Commit(); err != nil {
+			t.Fatalf("Commit: %v", err)
+		}
+
+		ef, found, err := store.FindFile("/data/a.txt", 1)
+		if err != nil {
+			t.Fatalf("FindFile: %v", err)
+		}
+		if !found {
+			t.Fatal("FindFile: expected to find /data/a.txt")
+		}
+		if ef.size != 10 || ef.hash != "h1" {
+			t.Errorf("FindFile returned %+v, want size=10 hash=h1", ef)
+		}
+
+		if _, found, err := store.FindFile("/data/missing.txt", 99); err != nil {
+			t.Fatalf("FindFile: %v", err)
+		} else if found {
+			t.Error("FindFile: expected not to find /data/missing.txt")
+		}
+
+		// FinishScan must not mark any file seen in this scan deleted, and must
+		// complete - it previously deadlocked for the bbolt backend if an
+		// earlier batch was left open (see the chunk0-4 fix history).
+		if err := store.FinishScan(scanID); err != nil {
+			t.Fatalf("FinishScan: %v", err)
+		}
+
+		count, err := store.CountByStatus(scanID, "new")
+		if err != nil {
+			t.Fatalf("CountByStatus: %v", err)
+		}
+		if count != 2 {
+			t.Errorf("CountByStatus(new) = %d, want 2", count)
+		}
+
+		if count, err := store.CountByStatus(scanID, "deleted"); err != nil {
+			t.Fatalf("CountByStatus: %v", err)
+		} else if count != 0 {
+			t.Errorf("CountByStatus(deleted) = %d, want 0", count)
+		}
+	})
+}
+
+func TestStoreFinishScanMarksMissingFilesDeleted(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		scan1, err := store.StartScan("/data")
+		if err != nil {
+			t.Fatalf("StartScan: %v", err)
+		}
+
+		batch, err := store.BeginBatch()
+		if err != nil {
+			t.Fatalf("BeginBatch: %v", err)
+		}
+		now := time.Now()
+		if err := batch.PutFile(fileRecord{path: "/data/gone.txt", name: "gone.txt", size: 1, modTime: now, birthTime: now, inode: 1, scanID: scan1, status: "new"}); err != nil {
+			t.Fatalf("PutFile: %v", err)
+		}
+		if err := batch.Commit(); err != nil {
+			t.Fatalf("Commit: %v", err)
+		}
+		if err := store.FinishScan(scan1); err != nil {
+			t.Fatalf("FinishScan: %v", err)
+		}
+
+		// A second scan that never sees /data/gone.txt again should mark
+		// it deleted once finished.
+		scan2, err := store.StartScan("/data")
+		if err != nil {
+			t.Fatalf("StartScan: %v", err)
+		}
+		if err := store.FinishScan(scan2); err != nil {
+			t.Fatalf("FinishScan: %v", err)
+		}
+
+		count, err := store.CountByStatus(scan2, "deleted")
+		if err != nil {
+			t.Fatalf("CountByStatus: %v", err)
+		}
+		if count != 1 {
+			t.Errorf("CountByStatus(deleted) = %d, want 1", count)
+		}
+	})
+}
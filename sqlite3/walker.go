@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// walkConcurrent traverses root breadth-first using dirWorkers goroutines
+// pulling from a shared queue of directories, pushing every file it finds
+// onto paths. It replaces filepath.Walk's single-goroutine traversal,
+// which left the CPU idle while waiting on each stat(2)/readdir(2) call -
+// the dominant cost when scanning many small directories over NFS/USB/SD.
+//
+// pendingDirs tracks outstanding directory jobs so the queue can be closed
+// once there's nothing left to discover, without a fixed-size work list
+// known up front.
+func walkConcurrent(root string, dirWorkers int, paths chan<- string) error {
+	if dirWorkers < 1 {
+		dirWorkers = 1
+	}
+
+	dirs := make(chan string, 4096)
+	errs := make(chan error, 4096)
+	var pendingDirs int64
+
+	queue := func(dir string) {
+		atomic.AddInt64(&pendingDirs, 1)
+		dirs <- dir
+	}
+
+	// Collect errors as they arrive instead of after the workers finish:
+	// errs has to stay drained while workers are still running, or a
+	// worker blocks forever trying to report an error nobody is reading
+	// yet, which in turn means it never calls workers.Done().
+	var firstErr error
+	errsDone := make(chan struct{})
+	go func() {
+		defer close(errsDone)
+		for err := range errs {
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}()
+
+	var workers sync.WaitGroup
+	workers.Add(dirWorkers)
+	for i := 0; i < dirWorkers; i++ {
+		go func() {
+			defer workers.Done()
+			for dir := range dirs {
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					metricWalkErrors.Add(1)
+					errs <- fmt.Errorf("error reading directory %q: %v", dir, err)
+				} else {
+					for _, entry := range entries {
+						full := filepath.Join(dir, entry.Name())
+						if entry.IsDir() {
+							queue(full)
+						} else {
+							paths <- full
+						}
+					}
+				}
+				if atomic.AddInt64(&pendingDirs, -1) == 0 {
+					close(dirs)
+				}
+			}
+		}()
+	}
+
+	queue(root)
+	workers.Wait()
+	close(errs)
+	<-errsDone
+
+	return firstErr
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWalkConcurrentFindsAllFiles(t *testing.T) {
+	root := t.TempDir()
+	want := 0
+	for i := 0; i < 5; i++ {
+		sub := filepath.Join(root, fmt.Sprintf("d%d", i))
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 10; j++ {
+			if err := os.WriteFile(filepath.Join(sub, fmt.Sprintf("f%d.txt", j)), []byte("x"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			want++
+		}
+	}
+
+	paths := make(chan string, 16)
+	var got []string
+	var drain sync.WaitGroup
+	drain.Add(1)
+	go func() {
+		defer drain.Done()
+		for p := range paths {
+			got = append(got, p)
+		}
+	}()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- walkConcurrent(root, 4, paths) }()
+
+	select {
+	case err := <-errCh:
+		close(paths)
+		if err != nil {
+			t.Fatalf("walkConcurrent: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("walkConcurrent did not return within 10s")
+	}
+
+	drain.Wait()
+	if len(got) != want {
+		t.Errorf("found %d files, want %d", len(got), want)
+	}
+}
+
+// TestWalkConcurrentDrainsErrorsWithoutDeadlock guards against a regression
+// of the bug fixed for walker.go's errs channel: workers blocked forever
+// writing to errs because nothing read it until every worker had already
+// finished, which none of them could do while blocked.
+func TestWalkConcurrentDrainsErrorsWithoutDeadlock(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "does-not-exist")
+
+	paths := make(chan string, 64)
+	go func() {
+		for range paths {
+		}
+	}()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- walkConcurrent(root, 8, paths) }()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Error("walkConcurrent: expected an error for a nonexistent root")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("walkConcurrent did not return within 10s - possible deadlock draining errs")
+	}
+}